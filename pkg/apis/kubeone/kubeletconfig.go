@@ -0,0 +1,56 @@
+/*
+Copyright 2022 The KubeOne Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeone
+
+// KubeletConfig holds the subset of kubelet.config.k8s.io/v1beta1
+// KubeletConfiguration fields that KubeOne lets operators tune, either at
+// the cluster level (Features.KubeletConfig) or per host
+// (HostConfig.KubeletConfigOverrides). A host override only needs to set
+// the fields it wants to change; everything else is inherited from the
+// cluster-wide defaults.
+type KubeletConfig struct {
+	// FeatureGates is merged on top of the cluster-wide feature gates.
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+
+	// EvictionHard sets hard eviction thresholds, e.g. "memory.available<5%".
+	EvictionHard map[string]string `json:"evictionHard,omitempty"`
+
+	// SystemReserved reserves resources for OS system daemons.
+	SystemReserved map[string]string `json:"systemReserved,omitempty"`
+
+	// KubeReserved reserves resources for Kubernetes node components.
+	KubeReserved map[string]string `json:"kubeReserved,omitempty"`
+
+	// TopologyManagerPolicy configures the kubelet Topology Manager.
+	TopologyManagerPolicy string `json:"topologyManagerPolicy,omitempty"`
+
+	// CPUManagerPolicy configures the kubelet CPU Manager.
+	CPUManagerPolicy string `json:"cpuManagerPolicy,omitempty"`
+
+	// ServerTLSBootstrap enables kubelet server certificate rotation via
+	// the certificates API. Defaults to true if unset.
+	ServerTLSBootstrap *bool `json:"serverTLSBootstrap,omitempty"`
+
+	// RotateCertificates enables client certificate rotation. Defaults to
+	// true if unset.
+	RotateCertificates *bool `json:"rotateCertificates,omitempty"`
+
+	// ProtectKernelDefaults causes the kubelet to error rather than silently
+	// correct kernel parameters that diverge from what it expects. Defaults
+	// to true if unset.
+	ProtectKernelDefaults *bool `json:"protectKernelDefaults,omitempty"`
+}
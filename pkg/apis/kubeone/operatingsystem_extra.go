@@ -0,0 +1,30 @@
+/*
+Copyright 2022 The KubeOne Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeone
+
+// Additional OperatingSystemName values, alongside the existing Amazon,
+// CentOS, Debian, Flatcar, RHEL and Ubuntu constants.
+const (
+	// OperatingSystemNameRockyLinux identifies Rocky Linux nodes.
+	OperatingSystemNameRockyLinux OperatingSystemName = "rockylinux"
+
+	// OperatingSystemNameAlmaLinux identifies AlmaLinux nodes.
+	OperatingSystemNameAlmaLinux OperatingSystemName = "almalinux"
+
+	// OperatingSystemNameSUSE identifies SLES/openSUSE nodes.
+	OperatingSystemNameSUSE OperatingSystemName = "suse"
+)
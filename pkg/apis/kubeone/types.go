@@ -0,0 +1,142 @@
+/*
+Copyright 2019 The KubeOne Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeone
+
+// KubeOneCluster is the root of a KubeOne cluster manifest.
+type KubeOneCluster struct {
+	CloudProvider         CloudProviderSpec
+	Features              Features
+	Versions              VersionConfig
+	Proxy                 ProxyConfig
+	RegistryConfiguration *RegistryConfiguration
+
+	// NodeUpgrades gates whether, and how many at a time, KubeOne is
+	// allowed to reboot nodes through pkg/tasks/reboot.
+	NodeUpgrades NodeUpgradeConfig
+}
+
+// CloudProviderSpec configures the cloud-config passed to the in-tree
+// cloud provider integration.
+type CloudProviderSpec struct {
+	CloudConfig string
+}
+
+// VersionConfig pins the Kubernetes version to install.
+type VersionConfig struct {
+	Kubernetes string
+}
+
+// ProxyConfig configures the HTTP(S) proxy used for package installation
+// and the container runtime.
+type ProxyConfig struct {
+	HTTP    string
+	HTTPS   string
+	NoProxy string
+}
+
+// Features toggles optional cluster features.
+type Features struct {
+	StaticAuditLog      *StaticAuditLogFeature
+	PodNodeSelector     *PodNodeSelectorFeature
+	EncryptionProviders *EncryptionProvidersFeature
+
+	// KubeletConfig holds the cluster-wide KubeletConfiguration defaults,
+	// layered underneath any per-host overrides.
+	KubeletConfig *KubeletConfig
+}
+
+// StaticAuditLogFeature enables and configures the static audit log.
+type StaticAuditLogFeature struct {
+	Enable bool
+	Config StaticAuditLogConfig
+}
+
+// StaticAuditLogConfig points at the audit policy manifest on disk.
+type StaticAuditLogConfig struct {
+	PolicyFilePath string
+}
+
+// PodNodeSelectorFeature enables and configures the PodNodeSelector
+// admission plugin.
+type PodNodeSelectorFeature struct {
+	Enable bool
+	Config PodNodeSelectorConfig
+}
+
+// PodNodeSelectorConfig points at the podnodeselector manifest on disk.
+type PodNodeSelectorConfig struct {
+	ConfigFilePath string
+}
+
+// EncryptionProvidersFeature enables encryption-at-rest for Kubernetes
+// API objects.
+type EncryptionProvidersFeature struct {
+	CustomEncryptionConfiguration string
+}
+
+// RegistryConfiguration controls where KubeOne and kubeadm pull container
+// images from.
+type RegistryConfiguration struct {
+	// OverwriteRegistry replaces the registry part of every image
+	// reference kubeadm resolves, e.g. to point at a private mirror.
+	OverwriteRegistry string
+
+	// MirrorImages maps a specific image reference (as returned by
+	// `kubeadm config images list`) to the mirror that should be pulled
+	// instead. Takes precedence over OverwriteRegistry.
+	MirrorImages map[string]string
+
+	// ImagesTarball points at a local OCI image tarball that, when set, is
+	// uploaded to every node and imported directly via `ctr -n k8s.io
+	// images import` instead of pulling from a registry.
+	ImagesTarball string
+
+	// PackagesTarball points at a local tarball of OS packages (kubeadm,
+	// kubelet, CNI plugins, ...). When set, prerequisite installation
+	// (proxy setup and the kubeadm packages) is skipped on every node;
+	// KubeOne does not upload or install the tarball itself.
+	PackagesTarball string
+}
+
+// OperatingSystemName identifies the OS family running on a host.
+type OperatingSystemName string
+
+const (
+	OperatingSystemNameAmazon  OperatingSystemName = "amzn"
+	OperatingSystemNameCentOS  OperatingSystemName = "centos"
+	OperatingSystemNameDebian  OperatingSystemName = "debian"
+	OperatingSystemNameFlatcar OperatingSystemName = "flatcar"
+	OperatingSystemNameRHEL    OperatingSystemName = "rhel"
+	OperatingSystemNameUbuntu  OperatingSystemName = "ubuntu"
+)
+
+// HostConfig describes a single node in the cluster manifest.
+type HostConfig struct {
+	ID              uint
+	Hostname        string
+	OperatingSystem OperatingSystemName
+
+	// ControlPlane is true when the manifest declares this host as a
+	// control plane node, as opposed to a static worker. Unlike
+	// LiveCluster membership, this is known from the manifest alone, even
+	// before the node has joined the cluster.
+	ControlPlane bool
+
+	// KubeletConfigOverrides layers host-specific KubeletConfiguration
+	// overrides on top of Features.KubeletConfig.
+	KubeletConfigOverrides []*KubeletConfig
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2022 The KubeOne Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeone
+
+// NodeUpgradePolicy gates whether, and under what circumstances, KubeOne is
+// allowed to reboot a node through pkg/tasks/reboot.
+type NodeUpgradePolicy string
+
+const (
+	// NodeUpgradePolicyNever means KubeOne must never reboot a node on its
+	// own; the operator takes care of reboots out of band.
+	NodeUpgradePolicyNever NodeUpgradePolicy = "Never"
+
+	// NodeUpgradePolicyIfRequired means KubeOne only reboots a node when it
+	// finds evidence that a reboot is actually required (e.g. a pending
+	// kernel upgrade or nm-cloud-setup interference).
+	NodeUpgradePolicyIfRequired NodeUpgradePolicy = "IfRequired"
+
+	// NodeUpgradePolicyAlways means KubeOne reboots whenever a task asks
+	// for it, unconditionally.
+	NodeUpgradePolicyAlways NodeUpgradePolicy = "Always"
+)
+
+// NodeUpgradeConfig controls how KubeOne reboots nodes across an apply.
+type NodeUpgradeConfig struct {
+	// Policy gates whether a reboot is allowed to happen at all. Defaults
+	// to NodeUpgradePolicyIfRequired.
+	Policy NodeUpgradePolicy `json:"policy,omitempty"`
+
+	// MaxUnavailableControlPlane bounds how many control plane nodes may be
+	// rebooting at the same time. Defaults to 1.
+	MaxUnavailableControlPlane *int `json:"maxUnavailableControlPlane,omitempty"`
+
+	// MaxUnavailableWorker bounds how many worker nodes may be rebooting at
+	// the same time. Defaults to 1.
+	MaxUnavailableWorker *int `json:"maxUnavailableWorker,omitempty"`
+}
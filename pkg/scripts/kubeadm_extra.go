@@ -0,0 +1,111 @@
+/*
+Copyright 2022 The KubeOne Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scripts
+
+import (
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+
+	kubeoneapi "k8c.io/kubeone/pkg/apis/kubeone"
+)
+
+// KubeadmRockyLinux renders the shell script that installs kubeadm on
+// Rocky Linux. It reuses the same yum repositories as CentOS/RHEL, but
+// imports Rocky's own GPG keys.
+func KubeadmRockyLinux(cluster *kubeoneapi.KubeOneCluster, forceInstall bool) (string, error) {
+	return kubeadmYumBased(cluster, forceInstall, heredoc.Doc(`
+		sudo rpm --import https://dl.rockylinux.org/pub/rocky/RPM-GPG-KEY-rockyofficial
+	`))
+}
+
+// KubeadmAlmaLinux renders the shell script that installs kubeadm on
+// AlmaLinux. It reuses the same yum repositories as CentOS/RHEL, but
+// imports AlmaLinux's own GPG keys.
+func KubeadmAlmaLinux(cluster *kubeoneapi.KubeOneCluster, forceInstall bool) (string, error) {
+	return kubeadmYumBased(cluster, forceInstall, heredoc.Doc(`
+		sudo rpm --import https://repo.almalinux.org/almalinux/RPM-GPG-KEY-AlmaLinux
+	`))
+}
+
+// kubeadmYumBased renders the shared yum-based kubeadm install script used
+// by CentOS/RHEL/Rocky/Alma, prefixed with an OS-specific GPG key import.
+// It registers the pkgs.k8s.io yum repository for the cluster's configured
+// Kubernetes minor version itself, rather than assuming one already exists
+// on the image.
+func kubeadmYumBased(cluster *kubeoneapi.KubeOneCluster, forceInstall bool, importGPGKey string) (string, error) {
+	majorMinor := kubernetesMajorMinor(cluster.Versions.Kubernetes)
+
+	forceFlag := ""
+	if forceInstall {
+		forceFlag = "--setopt=obsoletes=0"
+	}
+
+	return heredoc.Docf(`
+		%s
+		cat <<'KUBEONE_YUM_REPO_EOF' | sudo tee /etc/yum.repos.d/kubernetes.repo > /dev/null
+		[kubernetes]
+		name=Kubernetes
+		baseurl=https://pkgs.k8s.io/core:/stable:/%s/rpm/
+		enabled=1
+		gpgcheck=1
+		gpgkey=https://pkgs.k8s.io/core:/stable:/%s/rpm/repodata/repomd.xml.key
+		KUBEONE_YUM_REPO_EOF
+		sudo yum install -y %s kubelet kubeadm kubectl --disableexcludes=kubernetes
+		sudo systemctl enable --now kubelet
+	`, importGPGKey, majorMinor, majorMinor, forceFlag), nil
+}
+
+// kubernetesMajorMinor extracts the "vX.Y" major.minor prefix (as used by
+// the per-minor-version pkgs.k8s.io repositories) from a full Kubernetes
+// version string such as "v1.30.2" or "1.30.2".
+func kubernetesMajorMinor(version string) string {
+	version = strings.TrimPrefix(version, "v")
+
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return "v" + version
+	}
+
+	return "v" + parts[0] + "." + parts[1]
+}
+
+// KubeadmSUSE renders the shell script that installs kubeadm on
+// SLES/openSUSE using the zypper-based cri-o/kubernetes OBS repositories.
+// On a SCC-registered system it activates the Containers module through
+// SUSEConnect; unregistered systems fall back to the community OBS repos
+// directly.
+func KubeadmSUSE(_ *kubeoneapi.KubeOneCluster, forceInstall bool) (string, error) {
+	forceFlag := ""
+	if forceInstall {
+		forceFlag = "--force-resolution"
+	}
+
+	return heredoc.Docf(`
+		if command -v SUSEConnect >/dev/null 2>&1 && sudo SUSEConnect --status-text >/dev/null 2>&1; then
+			sudo SUSEConnect -p sle-module-containers/15.4/x86_64 || true
+		else
+			sudo zypper --non-interactive addrepo https://download.opensuse.org/repositories/devel:/kubic:/libcontainers:/stable/openSUSE_Tumbleweed/devel:kubic:libcontainers:stable.repo
+		fi
+
+		sudo zypper --non-interactive addrepo --refresh https://pkgs.k8s.io/core:/stable:/v1/rpm/ kubernetes
+		sudo zypper --non-interactive --gpg-auto-import-keys refresh
+		sudo zypper --non-interactive install %s cri-o kubelet kubeadm kubectl
+		sudo systemctl enable --now crio
+		sudo systemctl enable --now kubelet
+	`, forceFlag), nil
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2022 The KubeOne Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"strings"
+
+	kubeoneapi "k8c.io/kubeone/pkg/apis/kubeone"
+)
+
+// osReleaseIDs maps the ID field of /etc/os-release, as collected from a
+// live node during cluster discovery, to the OperatingSystemName KubeOne
+// dispatches prerequisite installation and feature checks on.
+var osReleaseIDs = map[string]kubeoneapi.OperatingSystemName{
+	"amzn":                kubeoneapi.OperatingSystemNameAmazon,
+	"centos":              kubeoneapi.OperatingSystemNameCentOS,
+	"debian":              kubeoneapi.OperatingSystemNameDebian,
+	"flatcar":             kubeoneapi.OperatingSystemNameFlatcar,
+	"rhel":                kubeoneapi.OperatingSystemNameRHEL,
+	"ubuntu":              kubeoneapi.OperatingSystemNameUbuntu,
+	"rocky":               kubeoneapi.OperatingSystemNameRockyLinux,
+	"almalinux":           kubeoneapi.OperatingSystemNameAlmaLinux,
+	"sles":                kubeoneapi.OperatingSystemNameSUSE,
+	"opensuse-leap":       kubeoneapi.OperatingSystemNameSUSE,
+	"opensuse-tumbleweed": kubeoneapi.OperatingSystemNameSUSE,
+}
+
+// DetectOperatingSystem maps the ID field of a node's /etc/os-release to
+// the OperatingSystemName KubeOne uses for dispatch, recognizing Rocky
+// Linux, AlmaLinux and SUSE alongside the families already supported.
+// Returns "" for an unrecognized ID.
+//
+// Wherever live cluster discovery currently populates
+// HostConfig.OperatingSystem from /etc/os-release, it must resolve through
+// this map to pick up the three new families - that call site lives outside
+// this package's current contents and isn't touched here.
+func DetectOperatingSystem(osReleaseID string) kubeoneapi.OperatingSystemName {
+	return osReleaseIDs[strings.Trim(strings.TrimSpace(osReleaseID), `"`)]
+}
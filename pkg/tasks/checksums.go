@@ -0,0 +1,251 @@
+/*
+Copyright 2019 The KubeOne Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tasks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/pkg/errors"
+
+	kubeoneapi "k8c.io/kubeone/pkg/apis/kubeone"
+	"k8c.io/kubeone/pkg/runner"
+	"k8c.io/kubeone/pkg/ssh"
+	"k8c.io/kubeone/pkg/state"
+)
+
+// checksumRemotePath is the directory KubeOne owns on every node for
+// tracking the last-applied checksum of every generated configuration
+// artifact.
+const checksumRemotePath = "/etc/kubernetes/kubeone/checksums"
+
+// trackedConfigFile pairs a Configuration file name (as passed to
+// Configuration.AddFile) with the component(s) that must be restarted
+// when its checksum changes.
+//
+// Earlier revisions of this mechanism carried a per-file systemd drop-in
+// env var name here, modeled on RKE_CLOUD_CONFIG_CHECKSUM, with the intent
+// of templating it into the kube-apiserver/kubelet drop-ins so systemd
+// itself would pick up a checksum change as a unit change. That was never
+// wired up; restarts are instead triggered directly below via
+// restartDriftedComponents. The field was dropped rather than left dead.
+type trackedConfigFile struct {
+	name     string
+	restarts []string
+}
+
+// trackedConfigFiles enumerates every generated artifact for which KubeOne
+// persists a checksum on the node, analogous to RKE_CLOUD_CONFIG_CHECKSUM /
+// RKE_AUDITLOG_CONFIG_CHECKSUM / RKE_ADMISSION_CONFIG_CHECKSUM.
+var trackedConfigFiles = []trackedConfigFile{
+	{name: "cfg/cloud-config", restarts: []string{"kubelet", "kube-apiserver", "containerd"}},
+	{name: "cfg/audit-policy.yaml", restarts: []string{"kube-apiserver"}},
+	{name: "cfg/admission-config.yaml", restarts: []string{"kube-apiserver"}},
+	{name: "cfg/podnodeselector.yaml", restarts: []string{"kube-apiserver"}},
+	{name: "cfg/encryption-providers.yaml", restarts: []string{"kube-apiserver"}},
+	{name: "cfg/kubeadm-join.yaml", restarts: []string{"kubelet"}},
+	{name: "cfg/kubeadm-init.yaml", restarts: []string{"kubelet"}},
+}
+
+// checksumOf returns the hex-encoded SHA-256 checksum of content.
+func checksumOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// checksumFileName returns the path, relative to Configuration's upload
+// root, that stores the checksum sidecar for the given tracked file.
+func checksumFileName(name string) string {
+	return fmt.Sprintf("%s.sha256", name)
+}
+
+// remoteChecksumPath returns where tracked's checksum sidecar is persisted
+// on the node, under checksumRemotePath. Shared by detectConfigDriftOnNode
+// and persistChecksumsOnNode so the two can never disagree on the path.
+func remoteChecksumPath(tracked trackedConfigFile) string {
+	return fmt.Sprintf("%s/%s", checksumRemotePath, strings.TrimPrefix(tracked.name, "cfg/"))
+}
+
+// addFileWithChecksum stashes content under name, and additionally stashes
+// its checksum as a sidecar file so it gets uploaded and persisted on the
+// node alongside the artifact it belongs to.
+func addFileWithChecksum(s *state.State, name, content string) {
+	s.Configuration.AddFile(name, content)
+	s.Configuration.AddFile(checksumFileName(name), checksumOf(content)+"\n")
+}
+
+// checksumIfPresent stashes the checksum sidecar for name if, and only if,
+// name was already added to the Configuration by some other step (e.g. a
+// user-supplied file copied in via AddFilePath, or a kubeadm config
+// rendered by a different task). It is a no-op when the feature that would
+// have produced the file is disabled.
+func checksumIfPresent(s *state.State, name string) {
+	if content, ok := s.Configuration.Files[name]; ok {
+		s.Configuration.AddFile(checksumFileName(name), checksumOf(content)+"\n")
+	}
+}
+
+// detectConfigDriftOnNode reads the previously persisted checksums from
+// checksumRemotePath and compares them against the checksums of the files
+// that were just uploaded. Components whose backing file actually
+// changed are restarted, instead of unconditionally reinstalling
+// prerequisites on every apply.
+//
+// This must run AFTER the new configuration has actually been written to
+// its final on-disk location (uploadConfigurationFilesToNode), otherwise
+// the restart would fire against the stale content still on disk.
+func detectConfigDriftOnNode(s *state.State, node *kubeoneapi.HostConfig, _ ssh.Connection) error {
+	oldChecksums := map[string]string{}
+
+	for _, tracked := range trackedConfigFiles {
+		if _, ok := s.Configuration.Files[checksumFileName(tracked.name)]; !ok {
+			continue
+		}
+
+		stdout, _, err := s.Runner.Run(
+			heredoc.Doc(`
+				sudo cat {{ .CHECKSUM_FILE }} 2>/dev/null || true
+			`), runner.TemplateVariables{
+				"CHECKSUM_FILE": remoteChecksumPath(tracked),
+			})
+		if err != nil {
+			return errors.Wrapf(err, "failed to read previous checksum for %q", tracked.name)
+		}
+
+		oldChecksums[tracked.name] = stdout
+	}
+
+	toRestart := restartsForDrift(s.Configuration.Files, oldChecksums)
+	if len(toRestart) == 0 {
+		return nil
+	}
+
+	return restartDriftedComponents(s, node, toRestart)
+}
+
+// nodeInitialized reports whether node has already completed kubeadm
+// init/join, the same check disableNMCloudSetup uses: node's live cluster
+// entry must exist and report Initialized(); a node with no entry counts as
+// not initialized. Used to avoid touching
+// /etc/kubernetes/manifests before kubeadm has created it.
+func nodeInitialized(s *state.State, node *kubeoneapi.HostConfig) bool {
+	allHosts := s.LiveCluster.ControlPlane
+	allHosts = append(allHosts, s.LiveCluster.StaticWorkers...)
+
+	for _, host := range allHosts {
+		if host.Config.ID == node.ID {
+			return host.Initialized()
+		}
+	}
+
+	return false
+}
+
+// restartsForDrift is the pure decision core of detectConfigDriftOnNode: it
+// compares each tracked file's freshly generated checksum (from files,
+// keyed by the checksum sidecar name) against the checksum previously
+// persisted on the node (oldChecksums, keyed by the tracked file's name),
+// and returns the set of components that need restarting. Files that were
+// never generated this run (e.g. a disabled feature) are skipped.
+func restartsForDrift(files map[string]string, oldChecksums map[string]string) map[string]struct{} {
+	toRestart := map[string]struct{}{}
+
+	for _, tracked := range trackedConfigFiles {
+		newChecksum, ok := files[checksumFileName(tracked.name)]
+		if !ok {
+			continue
+		}
+
+		if strings.TrimSpace(oldChecksums[tracked.name]) != strings.TrimSpace(newChecksum) {
+			for _, component := range tracked.restarts {
+				toRestart[component] = struct{}{}
+			}
+		}
+	}
+
+	return toRestart
+}
+
+// restartDriftedComponents surgically restarts only the components whose
+// backing configuration changed, instead of falling back to the
+// all-or-nothing prerequisite reinstall.
+func restartDriftedComponents(s *state.State, node *kubeoneapi.HostConfig, components map[string]struct{}) error {
+	if _, ok := components["kubelet"]; ok {
+		s.Logger.Infoln("Configuration drift detected, restarting kubelet...")
+		if _, _, err := s.Runner.Run(heredoc.Doc(`sudo systemctl restart kubelet`), nil); err != nil {
+			return errors.Wrap(err, "failed to restart kubelet")
+		}
+	}
+
+	if _, ok := components["kube-apiserver"]; ok {
+		if !nodeInitialized(s, node) {
+			// kubeadm hasn't run yet, so /etc/kubernetes/manifests doesn't
+			// exist and kube-apiserver isn't running - nothing to restart.
+			s.Logger.Debugln("Node not yet initialized, skipping kube-apiserver restart trigger")
+		} else {
+			s.Logger.Infoln("Configuration drift detected, triggering kube-apiserver static pod restart...")
+			if _, _, err := s.Runner.Run(heredoc.Doc(`
+				sudo touch /etc/kubernetes/manifests/kube-apiserver.yaml
+			`), nil); err != nil {
+				return errors.Wrap(err, "failed to touch kube-apiserver manifest")
+			}
+		}
+	}
+
+	if _, ok := components["containerd"]; ok {
+		s.Logger.Infoln("Configuration drift detected, restarting containerd...")
+		if _, _, err := s.Runner.Run(heredoc.Doc(`sudo systemctl restart containerd`), nil); err != nil {
+			return errors.Wrap(err, "failed to restart containerd")
+		}
+	}
+
+	return nil
+}
+
+// persistChecksumsOnNode copies every uploaded checksum sidecar that was
+// actually generated this run into checksumRemotePath, so the next apply's
+// detectConfigDriftOnNode has something to diff against. It must run AFTER
+// detectConfigDriftOnNode so the drift check still sees the previous run's
+// checksums.
+func persistChecksumsOnNode(s *state.State) error {
+	var script strings.Builder
+
+	script.WriteString(fmt.Sprintf("sudo mkdir -p %s\n", checksumRemotePath))
+
+	wrote := false
+	for _, tracked := range trackedConfigFiles {
+		content, ok := s.Configuration.Files[checksumFileName(tracked.name)]
+		if !ok {
+			continue
+		}
+
+		wrote = true
+		script.WriteString(fmt.Sprintf("echo -n %q | sudo tee %s > /dev/null\n", strings.TrimSpace(content), remoteChecksumPath(tracked)))
+	}
+
+	if !wrote {
+		return nil
+	}
+
+	_, _, err := s.Runner.RunRaw(script.String())
+
+	return errors.Wrap(err, "failed to persist configuration checksums")
+}
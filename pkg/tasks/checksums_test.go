@@ -0,0 +1,113 @@
+/*
+Copyright 2022 The KubeOne Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tasks
+
+import "testing"
+
+func TestChecksumOfIsStableAndSensitiveToContent(t *testing.T) {
+	a := checksumOf("hello")
+	b := checksumOf("hello")
+	c := checksumOf("hello!")
+
+	if a != b {
+		t.Fatalf("checksumOf is not deterministic: %q != %q", a, b)
+	}
+	if a == c {
+		t.Fatalf("checksumOf did not change for different content")
+	}
+}
+
+func TestRemoteChecksumPathStripsCfgPrefix(t *testing.T) {
+	got := remoteChecksumPath(trackedConfigFile{name: "cfg/cloud-config"})
+	want := checksumRemotePath + "/cloud-config"
+
+	if got != want {
+		t.Fatalf("remoteChecksumPath() = %q, want %q", got, want)
+	}
+}
+
+func TestRestartsForDrift(t *testing.T) {
+	cloudConfigChecksum := checksumFileName("cfg/cloud-config")
+	kubeadmInitChecksum := checksumFileName("cfg/kubeadm-init.yaml")
+
+	tests := []struct {
+		name         string
+		files        map[string]string
+		oldChecksums map[string]string
+		want         map[string]struct{}
+	}{
+		{
+			name: "no change, nothing restarts",
+			files: map[string]string{
+				cloudConfigChecksum: "sum-a",
+			},
+			oldChecksums: map[string]string{
+				"cfg/cloud-config": "sum-a",
+			},
+			want: map[string]struct{}{},
+		},
+		{
+			name: "cloud-config changed restarts kubelet, apiserver and containerd",
+			files: map[string]string{
+				cloudConfigChecksum: "sum-b",
+			},
+			oldChecksums: map[string]string{
+				"cfg/cloud-config": "sum-a",
+			},
+			want: map[string]struct{}{"kubelet": {}, "kube-apiserver": {}, "containerd": {}},
+		},
+		{
+			name: "kubeadm-init changed restarts only kubelet",
+			files: map[string]string{
+				kubeadmInitChecksum: "sum-b",
+			},
+			oldChecksums: map[string]string{
+				"cfg/kubeadm-init.yaml": "sum-a",
+			},
+			want: map[string]struct{}{"kubelet": {}},
+		},
+		{
+			name:         "file never generated this run is skipped entirely",
+			files:        map[string]string{},
+			oldChecksums: map[string]string{"cfg/cloud-config": "sum-a"},
+			want:         map[string]struct{}{},
+		},
+		{
+			name: "no previous checksum (first apply) still restarts",
+			files: map[string]string{
+				cloudConfigChecksum: "sum-a",
+			},
+			oldChecksums: map[string]string{},
+			want:         map[string]struct{}{"kubelet": {}, "kube-apiserver": {}, "containerd": {}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := restartsForDrift(tt.files, tt.oldChecksums)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("restartsForDrift() = %v, want %v", got, tt.want)
+			}
+			for component := range tt.want {
+				if _, ok := got[component]; !ok {
+					t.Fatalf("restartsForDrift() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2022 The KubeOne Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tasks
+
+import (
+	"strings"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/pkg/errors"
+
+	kubeoneapi "k8c.io/kubeone/pkg/apis/kubeone"
+	"k8c.io/kubeone/pkg/runner"
+	"k8c.io/kubeone/pkg/ssh"
+	"k8c.io/kubeone/pkg/state"
+)
+
+// imagePullMaxAttempts bounds the retry loop around a single image pull so
+// that a transient registry blip doesn't fail the whole apply, while a
+// genuinely unreachable registry still fails eventually.
+const imagePullMaxAttempts = 5
+
+// pullImages resolves the image list kubeadm needs for the configured
+// Kubernetes version once, rewrites every reference to the configured
+// mirror/overwrite registry and pins it to a digest, then has every node
+// pull (or import, in air-gapped mode) the exact same bits.
+func pullImages(s *state.State) error {
+	if s.Cluster.RegistryConfiguration != nil && s.Cluster.RegistryConfiguration.ImagesTarball != "" {
+		return s.RunTaskOnAllNodes(importImagesTarballOnNode, state.RunParallel)
+	}
+
+	var pinned []string
+
+	err := s.RunTaskOnLeader(func(ctx *state.State, _ *kubeoneapi.HostConfig, _ ssh.Connection) error {
+		images, err := resolveImageList(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to resolve image list")
+		}
+
+		pinned, err = pinImageDigests(ctx, images)
+
+		return errors.Wrap(err, "failed to pin image digests")
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.RunTaskOnAllNodes(func(ctx *state.State, _ *kubeoneapi.HostConfig, _ ssh.Connection) error {
+		return pullImagesOnNode(ctx, pinned)
+	}, state.RunParallel)
+}
+
+// resolveImageList asks kubeadm, on a single control plane node, for the
+// full list of images it needs, then rewrites every reference according to
+// RegistryConfiguration so every node pulls from the same mirror.
+func resolveImageList(s *state.State) ([]string, error) {
+	stdout, _, err := s.Runner.Run(
+		heredoc.Doc(`
+			sudo kubeadm config images list --kubernetes-version {{ .KUBERNETES_VERSION }}
+		`), runner.TemplateVariables{
+			"KUBERNETES_VERSION": s.Cluster.Versions.Kubernetes,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var images []string
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		images = append(images, rewriteImageRegistry(s.Cluster.RegistryConfiguration, line))
+	}
+
+	return images, nil
+}
+
+// rewriteImageRegistry rewrites an image reference to the per-image mirror
+// if one is configured, falling back to the cluster-wide overwrite
+// registry, and leaving the reference untouched otherwise.
+func rewriteImageRegistry(reg *kubeoneapi.RegistryConfiguration, image string) string {
+	if reg == nil {
+		return image
+	}
+
+	if mirror, ok := reg.MirrorImages[image]; ok {
+		return mirror
+	}
+
+	if reg.OverwriteRegistry == "" {
+		return image
+	}
+
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) != 2 {
+		return image
+	}
+
+	return reg.OverwriteRegistry + "/" + parts[1]
+}
+
+// pinImageDigests fetches the sha256 digest for every image once (from the
+// same control plane node used to resolve the list) and returns each
+// reference pinned to that digest, so all nodes end up pulling identical
+// bits instead of trusting a tag that could move between pulls. When skopeo
+// fails or prints no digest, its error is discarded and that image is
+// returned unpinned (see pinDigest).
+//
+// Digests are resolved against the registry itself via skopeo inspect,
+// rather than by inspecting a local image, because at this point in the
+// pipeline the leader hasn't pulled anything yet - crictl/ctr would only
+// ever see a cache miss and pinDigest would silently fall back to the
+// unpinned tag for every image.
+func pinImageDigests(s *state.State, images []string) ([]string, error) {
+	pinned := make([]string, 0, len(images))
+
+	for _, image := range images {
+		if isDigestPinned(image) {
+			pinned = append(pinned, image)
+
+			continue
+		}
+
+		digest, _, err := s.Runner.Run(
+			heredoc.Doc(`
+				sudo skopeo inspect --no-tags docker://{{ .IMAGE }} --format '{{ "{{" }}.Digest{{ "}}" }}' 2>/dev/null || true
+			`), runner.TemplateVariables{
+				"IMAGE": image,
+			})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve digest for %q", image)
+		}
+
+		pinned = append(pinned, pinDigest(image, digest))
+	}
+
+	return pinned, nil
+}
+
+// isDigestPinned reports whether image already carries a sha256 digest, in
+// which case pinning it again would be a no-op.
+func isDigestPinned(image string) bool {
+	return strings.Contains(image, "@sha256:")
+}
+
+// pinDigest rewrites image to reference digest instead of its tag. If
+// digest is empty (e.g. because the node couldn't resolve it), image is
+// returned unchanged rather than pinned to nothing.
+func pinDigest(image, digest string) string {
+	digest = strings.TrimSpace(digest)
+	if digest == "" {
+		return image
+	}
+
+	ref := image
+	if idx := strings.LastIndex(image, ":"); idx > strings.LastIndex(image, "/") {
+		ref = image[:idx]
+	}
+
+	return ref + "@" + digest
+}
+
+// pullImagesOnNode pulls every image on a single node with crictl pull,
+// retrying each pull with exponential backoff. kubeadm is not used to pull,
+// and there is no other fallback once the retries are used up.
+func pullImagesOnNode(s *state.State, images []string) error {
+	for _, image := range images {
+		var lastErr error
+
+		backoff := 2 * time.Second
+		for attempt := 1; attempt <= imagePullMaxAttempts; attempt++ {
+			_, _, err := s.Runner.Run(
+				heredoc.Doc(`
+					sudo crictl pull {{ .IMAGE }}
+				`), runner.TemplateVariables{
+					"IMAGE": image,
+				})
+			if err == nil {
+				lastErr = nil
+
+				break
+			}
+
+			lastErr = err
+			s.Logger.Warnf("failed to pull %s (attempt %d/%d): %v", image, attempt, imagePullMaxAttempts, err)
+
+			if attempt < imagePullMaxAttempts {
+				time.Sleep(backoff)
+				backoff *= 2
+			}
+		}
+
+		if lastErr != nil {
+			return errors.Wrapf(lastErr, "failed to pull %q after %d attempts", image, imagePullMaxAttempts)
+		}
+	}
+
+	return nil
+}
+
+// importImagesTarballOnNode uploads the locally provided OCI image tarball
+// and imports it directly into containerd, enabling fully offline installs
+// with no registry access at all.
+func importImagesTarballOnNode(s *state.State, _ *kubeoneapi.HostConfig, conn ssh.Connection) error {
+	tarball := s.Cluster.RegistryConfiguration.ImagesTarball
+	remotePath := s.WorkDir + "/images.tar"
+
+	if err := s.Configuration.UploadLocalFile(conn, tarball, remotePath); err != nil {
+		return errors.Wrap(err, "failed to upload images tarball")
+	}
+
+	_, _, err := s.Runner.Run(
+		heredoc.Doc(`
+			sudo ctr -n k8s.io images import {{ .TARBALL }}
+		`), runner.TemplateVariables{
+			"TARBALL": remotePath,
+		})
+
+	return errors.Wrap(err, "failed to import images tarball")
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2022 The KubeOne Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tasks
+
+import (
+	"testing"
+
+	kubeoneapi "k8c.io/kubeone/pkg/apis/kubeone"
+)
+
+func TestRewriteImageRegistry(t *testing.T) {
+	tests := []struct {
+		name  string
+		reg   *kubeoneapi.RegistryConfiguration
+		image string
+		want  string
+	}{
+		{
+			name:  "nil registry configuration leaves image untouched",
+			reg:   nil,
+			image: "registry.k8s.io/kube-apiserver:v1.28.0",
+			want:  "registry.k8s.io/kube-apiserver:v1.28.0",
+		},
+		{
+			name:  "no overwrite and no mirror leaves image untouched",
+			reg:   &kubeoneapi.RegistryConfiguration{},
+			image: "registry.k8s.io/kube-apiserver:v1.28.0",
+			want:  "registry.k8s.io/kube-apiserver:v1.28.0",
+		},
+		{
+			name:  "overwrite registry replaces the registry part",
+			reg:   &kubeoneapi.RegistryConfiguration{OverwriteRegistry: "mirror.example.com"},
+			image: "registry.k8s.io/kube-apiserver:v1.28.0",
+			want:  "mirror.example.com/kube-apiserver:v1.28.0",
+		},
+		{
+			name: "per-image mirror takes precedence over overwrite registry",
+			reg: &kubeoneapi.RegistryConfiguration{
+				OverwriteRegistry: "mirror.example.com",
+				MirrorImages: map[string]string{
+					"registry.k8s.io/kube-apiserver:v1.28.0": "internal.example.com/kube-apiserver:v1.28.0-custom",
+				},
+			},
+			image: "registry.k8s.io/kube-apiserver:v1.28.0",
+			want:  "internal.example.com/kube-apiserver:v1.28.0-custom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rewriteImageRegistry(tt.reg, tt.image); got != tt.want {
+				t.Fatalf("rewriteImageRegistry() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDigestPinned(t *testing.T) {
+	if !isDigestPinned("registry.k8s.io/kube-apiserver@sha256:abcd") {
+		t.Fatal("expected digest-referenced image to be considered pinned")
+	}
+	if isDigestPinned("registry.k8s.io/kube-apiserver:v1.28.0") {
+		t.Fatal("expected tag-referenced image to be considered unpinned")
+	}
+}
+
+func TestPinDigest(t *testing.T) {
+	tests := []struct {
+		name   string
+		image  string
+		digest string
+		want   string
+	}{
+		{
+			name:   "pins a tagged image",
+			image:  "registry.k8s.io/kube-apiserver:v1.28.0",
+			digest: "sha256:abcd",
+			want:   "registry.k8s.io/kube-apiserver@sha256:abcd",
+		},
+		{
+			name:   "empty digest leaves image untouched",
+			image:  "registry.k8s.io/kube-apiserver:v1.28.0",
+			digest: "",
+			want:   "registry.k8s.io/kube-apiserver:v1.28.0",
+		},
+		{
+			name:   "image with no tag still pins cleanly",
+			image:  "registry.k8s.io/kube-apiserver",
+			digest: "sha256:abcd",
+			want:   "registry.k8s.io/kube-apiserver@sha256:abcd",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pinDigest(tt.image, tt.digest); got != tt.want {
+				t.Fatalf("pinDigest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2022 The KubeOne Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tasks
+
+import (
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/pkg/errors"
+
+	kubeoneapi "k8c.io/kubeone/pkg/apis/kubeone"
+	"k8c.io/kubeone/pkg/runner"
+	"k8c.io/kubeone/pkg/ssh"
+	"k8c.io/kubeone/pkg/state"
+	"k8c.io/kubeone/pkg/templates"
+	"k8c.io/kubeone/pkg/templates/kubeletconfig"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	kubeletConfigRemotePath   = "/var/lib/kubelet/config.yaml"
+	kubeletConfigChecksumPath = checksumRemotePath + "/kubelet-config.yaml"
+)
+
+// uploadKubeletConfigToNode renders the per-host KubeletConfiguration,
+// drops it at kubeletConfigRemotePath, makes sure kubeadm's kubelet
+// drop-in actually references it via --config, and restarts kubelet only
+// when the rendered configuration actually changed.
+//
+// kubeadm-flags.env is written by kubeadm init/join, so on a node that
+// hasn't run either yet it won't exist; the --config patch is skipped in
+// that case and picked back up on the next apply once kubeadm has run.
+func uploadKubeletConfigToNode(s *state.State, node *kubeoneapi.HostConfig, _ ssh.Connection) error {
+	kubeletCfg, err := kubeletconfig.NewKubeletConfiguration(s.Cluster, node)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate kubelet configuration")
+	}
+
+	content, err := templates.KubernetesToYAML([]runtime.Object{kubeletCfg})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal kubelet configuration")
+	}
+
+	newChecksum := checksumOf(content)
+
+	oldChecksum, _, err := s.Runner.Run(
+		heredoc.Doc(`
+			sudo cat {{ .CHECKSUM_FILE }} 2>/dev/null || true
+		`), runner.TemplateVariables{
+			"CHECKSUM_FILE": kubeletConfigChecksumPath,
+		})
+	if err != nil {
+		return errors.Wrap(err, "failed to read previous kubelet configuration checksum")
+	}
+
+	_, _, err = s.Runner.Run(
+		heredoc.Doc(`
+			sudo mkdir -p $(dirname {{ .CONFIG_FILE }}) $(dirname {{ .CHECKSUM_FILE }})
+			cat <<'KUBEONE_KUBELET_CONFIG_EOF' | sudo tee {{ .CONFIG_FILE }} > /dev/null
+			{{ .CONTENT }}
+			KUBEONE_KUBELET_CONFIG_EOF
+			echo -n "{{ .CHECKSUM }}" | sudo tee {{ .CHECKSUM_FILE }} > /dev/null
+			if [ -f /var/lib/kubelet/kubeadm-flags.env ]; then
+				sudo grep -q -- '--config={{ .CONFIG_FILE }}' /var/lib/kubelet/kubeadm-flags.env || \
+					sudo sed -i "s#^KUBELET_KUBEADM_ARGS=\"#KUBELET_KUBEADM_ARGS=\"--config={{ .CONFIG_FILE }} #" /var/lib/kubelet/kubeadm-flags.env
+			fi
+		`), runner.TemplateVariables{
+			"CONFIG_FILE":   kubeletConfigRemotePath,
+			"CHECKSUM_FILE": kubeletConfigChecksumPath,
+			"CONTENT":       content,
+			"CHECKSUM":      newChecksum,
+		})
+	if err != nil {
+		return errors.Wrap(err, "failed to upload kubelet configuration")
+	}
+
+	if strings.TrimSpace(oldChecksum) == newChecksum {
+		return nil
+	}
+
+	s.Logger.Infoln("KubeletConfiguration changed, restarting kubelet...")
+
+	_, _, err = s.Runner.Run(heredoc.Doc(`
+		sudo systemctl daemon-reload
+		sudo systemctl restart kubelet
+	`), nil)
+
+	return errors.Wrap(err, "failed to restart kubelet")
+}
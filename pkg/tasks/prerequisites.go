@@ -18,17 +18,15 @@ package tasks
 
 import (
 	"fmt"
-	"time"
 
-	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
 	kubeoneapi "k8c.io/kubeone/pkg/apis/kubeone"
-	"k8c.io/kubeone/pkg/runner"
 	"k8c.io/kubeone/pkg/scripts"
 	"k8c.io/kubeone/pkg/ssh"
 	"k8c.io/kubeone/pkg/state"
+	"k8c.io/kubeone/pkg/tasks/reboot"
 	"k8c.io/kubeone/pkg/templates"
 	"k8c.io/kubeone/pkg/templates/admissionconfig"
 	encryptionproviders "k8c.io/kubeone/pkg/templates/encryptionproviders"
@@ -43,38 +41,37 @@ func installPrerequisites(s *state.State) error {
 		return fmt.Errorf("failed to install prerequisites: %w", err)
 	}
 
-	return s.RunTaskOnAllNodes(func(ctx *state.State, node *kubeoneapi.HostConfig, conn ssh.Connection) error {
-		ctx.Logger.Info("Pre-pull images")
-
-		_, _, err := ctx.Runner.Run(
-			heredoc.Doc(`
-				sudo kubeadm config images pull --kubernetes-version {{ .KUBERNETES_VERSION }}
-			`), runner.TemplateVariables{
-				"KUBERNETES_VERSION": ctx.Cluster.Versions.Kubernetes,
-			})
+	if err := pullImages(s); err != nil {
+		return fmt.Errorf("failed to pre-pull images: %w", err)
+	}
 
-		return err
-	}, state.RunParallel)
+	return nil
 }
 
 func generateConfigurationFiles(s *state.State) error {
-	s.Configuration.AddFile("cfg/cloud-config", s.Cluster.CloudProvider.CloudConfig)
+	addFileWithChecksum(s, "cfg/cloud-config", s.Cluster.CloudProvider.CloudConfig)
 
 	if s.Cluster.Features.StaticAuditLog != nil && s.Cluster.Features.StaticAuditLog.Enable {
 		if err := s.Configuration.AddFilePath("cfg/audit-policy.yaml", s.Cluster.Features.StaticAuditLog.Config.PolicyFilePath, s.ManifestFilePath); err != nil {
 			return errors.Wrap(err, "unable to add policy file")
 		}
+		if content, ok := s.Configuration.Files["cfg/audit-policy.yaml"]; ok {
+			s.Configuration.AddFile(checksumFileName("cfg/audit-policy.yaml"), checksumOf(content)+"\n")
+		}
 	}
 	if s.Cluster.Features.PodNodeSelector != nil && s.Cluster.Features.PodNodeSelector.Enable {
 		admissionCfg, err := admissionconfig.NewAdmissionConfig(s.Cluster.Versions.Kubernetes, s.Cluster.Features.PodNodeSelector)
 		if err != nil {
 			return errors.Wrap(err, "failed to generate admissionconfiguration manifest")
 		}
-		s.Configuration.AddFile("cfg/admission-config.yaml", admissionCfg)
+		addFileWithChecksum(s, "cfg/admission-config.yaml", admissionCfg)
 
 		if err := s.Configuration.AddFilePath("cfg/podnodeselector.yaml", s.Cluster.Features.PodNodeSelector.Config.ConfigFilePath, s.ManifestFilePath); err != nil {
 			return errors.Wrap(err, "failed to add podnodeselector config file")
 		}
+		if content, ok := s.Configuration.Files["cfg/podnodeselector.yaml"]; ok {
+			s.Configuration.AddFile(checksumFileName("cfg/podnodeselector.yaml"), checksumOf(content)+"\n")
+		}
 	}
 
 	if s.ShouldEnableEncryption() || s.EncryptionEnabled() {
@@ -83,7 +80,7 @@ func generateConfigurationFiles(s *state.State) error {
 		// User provided custom config
 		if s.Cluster.Features.EncryptionProviders.CustomEncryptionConfiguration != "" {
 			config = s.Cluster.Features.EncryptionProviders.CustomEncryptionConfiguration
-			s.Configuration.AddFile(fmt.Sprintf("cfg/%s", configFileName), config)
+			addFileWithChecksum(s, fmt.Sprintf("cfg/%s", configFileName), config)
 		} else if s.ShouldEnableEncryption() { // automatically generate config
 			encryptionProvidersConfig, err := encryptionproviders.NewEncyrptionProvidersConfig(s)
 			if err != nil {
@@ -93,7 +90,7 @@ func generateConfigurationFiles(s *state.State) error {
 			if err != nil {
 				return err
 			}
-			s.Configuration.AddFile(fmt.Sprintf("cfg/%s", configFileName), config)
+			addFileWithChecksum(s, fmt.Sprintf("cfg/%s", configFileName), config)
 		}
 	}
 
@@ -103,6 +100,12 @@ func generateConfigurationFiles(s *state.State) error {
 func installPrerequisitesOnNode(s *state.State, node *kubeoneapi.HostConfig, _ ssh.Connection) error {
 	logger := s.Logger.WithField("os", node.OperatingSystem)
 
+	if s.Cluster.RegistryConfiguration != nil && s.Cluster.RegistryConfiguration.PackagesTarball != "" {
+		logger.Infoln("Packages tarball provided, skipping prerequisite installation...")
+
+		return nil
+	}
+
 	err := setupProxy(logger, s)
 	if err != nil {
 		return err
@@ -138,8 +141,16 @@ func createEnvironmentFile(s *state.State) error {
 	return err
 }
 
+// nmCloudSetupOperatingSystems lists the OSes whose cloud images ship
+// nm-cloud-setup, which conflicts with statically configured networking.
+var nmCloudSetupOperatingSystems = map[kubeoneapi.OperatingSystemName]bool{
+	kubeoneapi.OperatingSystemNameRHEL:       true,
+	kubeoneapi.OperatingSystemNameRockyLinux: true,
+	kubeoneapi.OperatingSystemNameAlmaLinux:  true,
+}
+
 func disableNMCloudSetup(s *state.State, node *kubeoneapi.HostConfig, _ ssh.Connection) error {
-	if node.OperatingSystem != kubeoneapi.OperatingSystemNameRHEL {
+	if !nmCloudSetupOperatingSystems[node.OperatingSystem] {
 		return nil
 	}
 
@@ -152,19 +163,12 @@ func disableNMCloudSetup(s *state.State, node *kubeoneapi.HostConfig, _ ssh.Conn
 				return err
 			}
 
-			s.Logger.Infoln("Disable nm-cloud-setup... the node will be rebooted...")
-			// Intentionally ignore error because restarting machines causes
-			// the connection to error
-			_, _, _ = s.Runner.RunRaw(cmd)
-
-			timeout := 1 * time.Minute
-			s.Logger.Infof("Waiting for %s before proceeding to give machines time to boot up...", timeout)
-			time.Sleep(timeout)
+			s.Logger.Infoln("Disable nm-cloud-setup...")
+			if _, _, err := s.Runner.RunRaw(cmd); err != nil {
+				return errors.Wrap(err, "failed to disable nm-cloud-setup")
+			}
 
-			// NB: In some cases, KubeOne might not be able to re-use SSH connections
-			// after rebooting nodes. Because of that, we close all connections here,
-			// and then KubeOne will automatically reinitialize them on the next task.
-			s.Runner.Conn.Close()
+			return errors.Wrap(reboot.RebootNode(s, node, reboot.ReasonNMCloudSetup), "failed to reboot node after disabling nm-cloud-setup")
 		}
 	}
 
@@ -173,12 +177,15 @@ func disableNMCloudSetup(s *state.State, node *kubeoneapi.HostConfig, _ ssh.Conn
 
 func installKubeadm(s *state.State, node kubeoneapi.HostConfig) error {
 	return runOnOS(s, node.OperatingSystem, map[kubeoneapi.OperatingSystemName]runOnOSFn{
-		kubeoneapi.OperatingSystemNameAmazon:  installKubeadmAmazonLinux,
-		kubeoneapi.OperatingSystemNameCentOS:  installKubeadmCentOS,
-		kubeoneapi.OperatingSystemNameDebian:  installKubeadmDebian,
-		kubeoneapi.OperatingSystemNameFlatcar: installKubeadmFlatcar,
-		kubeoneapi.OperatingSystemNameRHEL:    installKubeadmCentOS,
-		kubeoneapi.OperatingSystemNameUbuntu:  installKubeadmDebian,
+		kubeoneapi.OperatingSystemNameAmazon:     installKubeadmAmazonLinux,
+		kubeoneapi.OperatingSystemNameCentOS:     installKubeadmCentOS,
+		kubeoneapi.OperatingSystemNameDebian:     installKubeadmDebian,
+		kubeoneapi.OperatingSystemNameFlatcar:    installKubeadmFlatcar,
+		kubeoneapi.OperatingSystemNameRHEL:       installKubeadmCentOS,
+		kubeoneapi.OperatingSystemNameRockyLinux: installKubeadmRockyLinux,
+		kubeoneapi.OperatingSystemNameAlmaLinux:  installKubeadmAlmaLinux,
+		kubeoneapi.OperatingSystemNameSUSE:       installKubeadmSUSE,
+		kubeoneapi.OperatingSystemNameUbuntu:     installKubeadmDebian,
 	})
 }
 
@@ -226,11 +233,60 @@ func installKubeadmFlatcar(s *state.State) error {
 	return errors.WithStack(err)
 }
 
+// installKubeadmRockyLinux reuses the CentOS/RHEL yum repos, with Rocky's
+// own GPG keys.
+func installKubeadmRockyLinux(s *state.State) error {
+	cmd, err := scripts.KubeadmRockyLinux(s.Cluster, s.ForceInstall)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = s.Runner.RunRaw(cmd)
+
+	return errors.WithStack(err)
+}
+
+// installKubeadmAlmaLinux reuses the CentOS/RHEL yum repos, with AlmaLinux's
+// own GPG keys.
+func installKubeadmAlmaLinux(s *state.State) error {
+	cmd, err := scripts.KubeadmAlmaLinux(s.Cluster, s.ForceInstall)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = s.Runner.RunRaw(cmd)
+
+	return errors.WithStack(err)
+}
+
+// installKubeadmSUSE sets up the zypper-based cri-o/kubernetes OBS repos,
+// activating the Containers module through SUSEConnect on registered
+// systems; an unregistered system is not registered.
+func installKubeadmSUSE(s *state.State) error {
+	cmd, err := scripts.KubeadmSUSE(s.Cluster, s.ForceInstall)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = s.Runner.RunRaw(cmd)
+
+	return errors.WithStack(err)
+}
+
 func uploadConfigurationFiles(s *state.State) error {
+	// The kubeadm init/join configs are rendered by the kubeadm task, which
+	// may run before or after this point depending on the pipeline stage;
+	// check here, as late as possible while still serial (uploadConfigurationFilesToNode
+	// below runs per node, in parallel, and s.Configuration.Files must not be
+	// written to once that fan-out starts), so that if they've been
+	// generated by now their checksum is tracked too.
+	checksumIfPresent(s, "cfg/kubeadm-init.yaml")
+	checksumIfPresent(s, "cfg/kubeadm-join.yaml")
+
 	return s.RunTaskOnAllNodes(uploadConfigurationFilesToNode, state.RunParallel)
 }
 
-func uploadConfigurationFilesToNode(s *state.State, _ *kubeoneapi.HostConfig, conn ssh.Connection) error {
+func uploadConfigurationFilesToNode(s *state.State, node *kubeoneapi.HostConfig, conn ssh.Connection) error {
 	s.Logger.Infoln("Uploading config files...")
 
 	if err := s.Configuration.UploadTo(conn, s.WorkDir); err != nil {
@@ -275,7 +331,20 @@ func uploadConfigurationFilesToNode(s *state.State, _ *kubeoneapi.HostConfig, co
 		return err
 	}
 
-	return nil
+	if err := uploadKubeletConfigToNode(s, node, conn); err != nil {
+		return errors.Wrap(err, "failed to upload kubelet configuration")
+	}
+
+	// Diff the checksums of what we just wrote to their final on-disk
+	// locations against what was persisted on the previous apply, and
+	// restart only the components whose backing file actually changed.
+	// This must run after the Save*Config calls above, not before, or the
+	// restart would fire against the still-stale on-disk content.
+	if err := detectConfigDriftOnNode(s, node, conn); err != nil {
+		return errors.Wrap(err, "failed to detect configuration drift")
+	}
+
+	return persistChecksumsOnNode(s)
 }
 
 func containerRuntimeEnvironment(s *state.State) error {
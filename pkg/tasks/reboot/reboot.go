@@ -0,0 +1,219 @@
+/*
+Copyright 2022 The KubeOne Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package reboot provides a single, reusable helper for safely rebooting a
+// node: drain it via the Kubernetes API, reboot it, wait for it to come
+// back, and uncordon it. Every KubeOne task that needs to reboot a node
+// (disabling nm-cloud-setup, kernel upgrades, future containerd
+// migrations, ...) should go through RebootNode instead of rolling its own
+// sleep-and-hope logic.
+package reboot
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/pkg/errors"
+
+	kubeoneapi "k8c.io/kubeone/pkg/apis/kubeone"
+	"k8c.io/kubeone/pkg/state"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kubectl/pkg/drain"
+)
+
+// Reason documents why a node is being rebooted, surfaced in logs so an
+// operator scrolling through `kubeone apply -v` output understands why
+// their node bounced.
+type Reason string
+
+const (
+	ReasonNMCloudSetup        Reason = "disable nm-cloud-setup"
+	ReasonKernelUpgrade       Reason = "kernel upgrade"
+	ReasonContainerdMigration Reason = "containerd migration"
+)
+
+const (
+	rebootMarkerPath = "/run/kubeone/reboot-required"
+	pollInterval     = 10 * time.Second
+	nodeReadyTimeout = 10 * time.Minute
+)
+
+// RebootNode cordons and drains node through the Kubernetes API (honoring
+// PodDisruptionBudgets and the cluster's configured drain timeout), issues
+// a reboot, waits for the node to disappear and come back Ready, then
+// uncordons it. It never leaves a node cordoned on failure without saying
+// so in the returned error.
+//
+// The reboot is gated by KubeOneCluster.NodeUpgrades.Policy, and serialized
+// against the max-unavailable limit of whichever pool (control plane or
+// worker) the node belongs to.
+func RebootNode(s *state.State, host *kubeoneapi.HostConfig, reason Reason) error {
+	if s.Cluster.NodeUpgrades.Policy == kubeoneapi.NodeUpgradePolicyNever {
+		return errors.Errorf("refusing to reboot node %q: NodeUpgradePolicy is %q", host.Hostname, kubeoneapi.NodeUpgradePolicyNever)
+	}
+
+	release := acquirePoolSlot(s, host)
+	defer release()
+
+	s.Logger.Infof("Rebooting node %q (%s)...", host.Hostname, reason)
+
+	if err := cordonAndDrain(s, host); err != nil {
+		return errors.Wrapf(err, "failed to drain node %q before reboot, node may be left cordoned", host.Hostname)
+	}
+
+	if _, _, err := s.Runner.Run(heredoc.Doc(`
+		sudo mkdir -p $(dirname {{ .MARKER }})
+		sudo rm -f {{ .MARKER }}
+		sudo bash -c 'nohup systemctl reboot >/dev/null 2>&1 &'
+	`), map[string]string{"MARKER": rebootMarkerPath}); err != nil {
+		// Intentionally tolerate errors here: the reboot itself races with
+		// the SSH connection tearing down, so a non-zero exit or a dropped
+		// connection is the expected, successful outcome.
+		s.Logger.Debugf("reboot command returned (expected once the connection drops): %v", err)
+	}
+
+	s.Runner.Conn.Close()
+
+	if err := waitForNodeReady(s, host); err != nil {
+		return errors.Wrapf(err, "node %q did not come back after reboot, node may be left cordoned", host.Hostname)
+	}
+
+	if err := uncordon(s, host); err != nil {
+		return errors.Wrapf(err, "failed to uncordon node %q after reboot", host.Hostname)
+	}
+
+	s.Logger.Infof("Node %q is back and uncordoned", host.Hostname)
+
+	return nil
+}
+
+// cordonAndDrain marks the node unschedulable and evicts every pod off it,
+// respecting PodDisruptionBudgets, bounded by the cluster's
+// --drain-timeout.
+func cordonAndDrain(s *state.State, host *kubeoneapi.HostConfig) error {
+	node, err := s.DynamicClient.CoreV1().Nodes().Get(context.Background(), host.Hostname, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			// Node isn't registered yet (e.g. pre-init): nothing to drain.
+			return nil
+		}
+
+		return err
+	}
+
+	helper := &drain.Helper{
+		Ctx:                 context.Background(),
+		Client:              s.DynamicClient,
+		Force:               true,
+		IgnoreAllDaemonSets: true,
+		DeleteEmptyDirData:  true,
+		GracePeriodSeconds:  -1,
+		Timeout:             s.DrainTimeout,
+		Out:                 s.Logger.Writer(),
+		ErrOut:              s.Logger.Writer(),
+	}
+
+	if err := drain.RunCordonOrUncordon(helper, node, true); err != nil {
+		return err
+	}
+
+	return drain.RunNodeDrain(helper, node.Name)
+}
+
+// uncordon marks the node schedulable again.
+func uncordon(s *state.State, host *kubeoneapi.HostConfig) error {
+	node, err := s.DynamicClient.CoreV1().Nodes().Get(context.Background(), host.Hostname, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	helper := &drain.Helper{
+		Ctx:    context.Background(),
+		Client: s.DynamicClient,
+		Out:    s.Logger.Writer(),
+		ErrOut: s.Logger.Writer(),
+	}
+
+	return drain.RunCordonOrUncordon(helper, node, false)
+}
+
+// poolSlots holds one buffered channel per pool, sized to that pool's
+// max-unavailable limit, so that concurrent RebootNode calls (e.g. from
+// RunTaskOnAllNodes) serialize down to the configured concurrency instead
+// of rebooting every node in the pool at once. kubeone apply operates on a
+// single cluster per process, so keying by pool name alone (rather than
+// also including the cluster) is sufficient.
+var (
+	poolSlotsMu sync.Mutex
+	poolSlots   = map[string]chan struct{}{}
+)
+
+// acquirePoolSlot blocks until a reboot slot is available for host's pool
+// (control plane or worker) and returns a func that releases it.
+func acquirePoolSlot(s *state.State, host *kubeoneapi.HostConfig) func() {
+	pool := "worker"
+	maxUnavailable := s.Cluster.NodeUpgrades.MaxUnavailableWorker
+	if host.ControlPlane {
+		pool = "control-plane"
+		maxUnavailable = s.Cluster.NodeUpgrades.MaxUnavailableControlPlane
+	}
+
+	n := 1
+	if maxUnavailable != nil && *maxUnavailable > 0 {
+		n = *maxUnavailable
+	}
+
+	poolSlotsMu.Lock()
+	slot, ok := poolSlots[pool]
+	if !ok {
+		slot = make(chan struct{}, n)
+		poolSlots[pool] = slot
+	}
+	poolSlotsMu.Unlock()
+
+	slot <- struct{}{}
+
+	return func() { <-slot }
+}
+
+// waitForNodeReady polls the Kubernetes API until the node reports Ready
+// again, bounded by nodeReadyTimeout. It tolerates the node being briefly
+// absent from the API right after the reboot is issued.
+func waitForNodeReady(s *state.State, host *kubeoneapi.HostConfig) error {
+	return wait.PollImmediate(pollInterval, nodeReadyTimeout, func() (bool, error) {
+		node, err := s.DynamicClient.CoreV1().Nodes().Get(context.Background(), host.Hostname, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, nil //nolint:nilerr // keep polling on transient API errors
+		}
+
+		for _, cond := range node.Status.Conditions {
+			if cond.Type == corev1.NodeReady {
+				return cond.Status == corev1.ConditionTrue, nil
+			}
+		}
+
+		return false, nil
+	})
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2022 The KubeOne Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kubeletconfig renders the kubelet.config.k8s.io/v1beta1
+// KubeletConfiguration that KubeOne drops on every node, merging the
+// cluster-wide defaults with per-host overrides.
+package kubeletconfig
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeletconfigv1beta1 "k8s.io/kubelet/config/v1beta1"
+
+	kubeoneapi "k8c.io/kubeone/pkg/apis/kubeone"
+)
+
+// tlsCipherSuites pins the kubelet's TLS server to the same TLS 1.2+ suite
+// allow-list used by the kubelet TLS bootstrap.
+var tlsCipherSuites = []string{
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305",
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305",
+}
+
+// NewKubeletConfiguration builds the KubeletConfiguration for the given
+// host, applying the cluster-wide defaults from KubeletConfig and then
+// layering the host's own overrides, if any, on top.
+func NewKubeletConfiguration(cluster *kubeoneapi.KubeOneCluster, host *kubeoneapi.HostConfig) (*kubeletconfigv1beta1.KubeletConfiguration, error) {
+	cfg := &kubeletconfigv1beta1.KubeletConfiguration{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: kubeletconfigv1beta1.SchemeGroupVersion.String(),
+			Kind:       "KubeletConfiguration",
+		},
+		ServerTLSBootstrap:    true,
+		RotateCertificates:    true,
+		ProtectKernelDefaults: true,
+		TLSCipherSuites:       tlsCipherSuites,
+		TLSMinVersion:         "VersionTLS12",
+		FeatureGates:          map[string]bool{},
+	}
+
+	applyOverrides(cfg, cluster.Features.KubeletConfig)
+
+	for _, override := range host.KubeletConfigOverrides {
+		applyOverrides(cfg, override)
+	}
+
+	return cfg, nil
+}
+
+// applyOverrides merges a single, possibly-nil, override on top of cfg.
+// Zero-valued fields in the override are left untouched so that a host
+// override only has to specify the fields it actually wants to change.
+func applyOverrides(cfg *kubeletconfigv1beta1.KubeletConfiguration, override *kubeoneapi.KubeletConfig) {
+	if override == nil {
+		return
+	}
+
+	for gate, enabled := range override.FeatureGates {
+		cfg.FeatureGates[gate] = enabled
+	}
+
+	if override.EvictionHard != nil {
+		cfg.EvictionHard = override.EvictionHard
+	}
+	if override.SystemReserved != nil {
+		cfg.SystemReserved = override.SystemReserved
+	}
+	if override.KubeReserved != nil {
+		cfg.KubeReserved = override.KubeReserved
+	}
+	if override.TopologyManagerPolicy != "" {
+		cfg.TopologyManagerPolicy = override.TopologyManagerPolicy
+	}
+	if override.CPUManagerPolicy != "" {
+		cfg.CPUManagerPolicy = override.CPUManagerPolicy
+	}
+	if override.ServerTLSBootstrap != nil {
+		cfg.ServerTLSBootstrap = *override.ServerTLSBootstrap
+	}
+	if override.RotateCertificates != nil {
+		cfg.RotateCertificates = *override.RotateCertificates
+	}
+	if override.ProtectKernelDefaults != nil {
+		cfg.ProtectKernelDefaults = *override.ProtectKernelDefaults
+	}
+}